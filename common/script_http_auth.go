@@ -0,0 +1,330 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScriptHTTPACL 脚本 HTTP 服务的访问控制列表
+type ScriptHTTPACL struct {
+	CIDRs []string `json:"cidrs"`
+}
+
+// scriptTokens 保存每个脚本标识符对应的 API Token
+var (
+	scriptTokens      = make(map[string]string) // identifier -> token
+	scriptTokensMutex sync.RWMutex
+
+	scriptACLs      = make(map[string]*ScriptHTTPACL) // identifier -> acl
+	scriptACLsMutex sync.RWMutex
+)
+
+// generateScriptHTTPToken 生成一个随机的 API Token
+func generateScriptHTTPToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成 Token 失败: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ensureScriptHTTPToken 如果脚本还没有 Token（包括磁盘上持久化的旧 Token），则生成一个新的
+func ensureScriptHTTPToken(identifier string) (string, error) {
+	loadScriptHTTPAuthStateOnce()
+
+	scriptTokensMutex.Lock()
+	if token, exists := scriptTokens[identifier]; exists {
+		scriptTokensMutex.Unlock()
+		return token, nil
+	}
+
+	token, err := generateScriptHTTPToken()
+	if err != nil {
+		scriptTokensMutex.Unlock()
+		return "", err
+	}
+	scriptTokens[identifier] = token
+	scriptTokensMutex.Unlock()
+
+	saveScriptHTTPAuthState()
+	return token, nil
+}
+
+// RotateScriptHTTPToken 重新生成脚本的 API Token
+func RotateScriptHTTPToken(scriptID string) (string, error) {
+	script, err := GetUserScriptByID(scriptID)
+	if err != nil {
+		return "", fmt.Errorf("获取脚本失败: %v", err)
+	}
+
+	identifier := GetScriptIdentifier(script)
+
+	loadScriptHTTPAuthStateOnce()
+
+	token, err := generateScriptHTTPToken()
+	if err != nil {
+		return "", err
+	}
+
+	scriptTokensMutex.Lock()
+	scriptTokens[identifier] = token
+	scriptTokensMutex.Unlock()
+	saveScriptHTTPAuthState()
+
+	if globalScriptEventCallback != nil {
+		globalScriptEventCallback("script.http.token_rotated", map[string]interface{}{
+			"scriptID":   script.ID,
+			"identifier": identifier,
+			"token":      token,
+		})
+	}
+
+	log.Printf("✅ 脚本 HTTP Token 已重新生成: %s -> /clip-save/%s", script.Name, identifier)
+	return token, nil
+}
+
+// SetScriptHTTPACL 设置脚本的 IP/CIDR 白名单，传入空切片表示不限制
+func SetScriptHTTPACL(scriptID string, cidrs []string) error {
+	script, err := GetUserScriptByID(scriptID)
+	if err != nil {
+		return fmt.Errorf("获取脚本失败: %v", err)
+	}
+
+	identifier := GetScriptIdentifier(script)
+
+	loadScriptHTTPAuthStateOnce()
+
+	for _, cidr := range cidrs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			// 不是合法的 CIDR 时，退回按单独 IP 校验（checkScriptHTTPACL 对不带掩码的条目按纯 IP 比较）
+			if net.ParseIP(cidr) == nil {
+				return fmt.Errorf("无效的 IP/CIDR: %s", cidr)
+			}
+		}
+	}
+
+	scriptACLsMutex.Lock()
+	if len(cidrs) == 0 {
+		delete(scriptACLs, identifier)
+	} else {
+		scriptACLs[identifier] = &ScriptHTTPACL{CIDRs: cidrs}
+	}
+	scriptACLsMutex.Unlock()
+	saveScriptHTTPAuthState()
+
+	if globalScriptEventCallback != nil {
+		globalScriptEventCallback("script.http.acl_updated", map[string]interface{}{
+			"scriptID":   script.ID,
+			"identifier": identifier,
+			"cidrs":      cidrs,
+		})
+	}
+
+	log.Printf("✅ 脚本 HTTP 白名单已更新: %s -> /clip-save/%s (%d 条)", script.Name, identifier, len(cidrs))
+	return nil
+}
+
+// checkScriptHTTPACL 校验远程地址是否在脚本的白名单内，脚本未设置白名单时默认放行
+func checkScriptHTTPACL(identifier, remoteIP string) bool {
+	scriptACLsMutex.RLock()
+	acl, exists := scriptACLs[identifier]
+	scriptACLsMutex.RUnlock()
+
+	if !exists || len(acl.CIDRs) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, cidr := range acl.CIDRs {
+		if !strings.Contains(cidr, "/") {
+			if ip.Equal(net.ParseIP(cidr)) {
+				return true
+			}
+			continue
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenBucket 简单的令牌桶限流器
+type tokenBucket struct {
+	tokens     float64
+	ratePerSec float64
+	burst      float64
+	lastRefill time.Time
+}
+
+// allow 判断是否还有可用令牌，调用时消耗一个令牌
+func (b *tokenBucket) allow(now time.Time) bool {
+	elapsed := now.Sub(b.lastRefill).Seconds()
+	b.lastRefill = now
+	b.tokens += elapsed * b.ratePerSec
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// ScriptHTTPRateLimit 脚本 HTTP 服务的限流配置
+type ScriptHTTPRateLimit struct {
+	RequestsPerSecond float64
+	Burst             float64
+}
+
+// defaultScriptHTTPRateLimit 未单独配置限流的脚本使用的默认值
+var defaultScriptHTTPRateLimit = ScriptHTTPRateLimit{RequestsPerSecond: 5, Burst: 10}
+
+var (
+	scriptRateLimiters      = make(map[string]*ScriptHTTPRateLimit) // identifier -> 自定义限流配置
+	scriptRateLimitersMutex sync.RWMutex
+
+	rateLimitBuckets      = make(map[string]*tokenBucket) // "identifier|ip" -> bucket
+	rateLimitBucketsMutex sync.Mutex
+)
+
+// SetScriptHTTPRateLimit 设置脚本的限流速率，rps <= 0 时恢复默认值
+func SetScriptHTTPRateLimit(scriptID string, rps, burst float64) error {
+	script, err := GetUserScriptByID(scriptID)
+	if err != nil {
+		return fmt.Errorf("获取脚本失败: %v", err)
+	}
+
+	identifier := GetScriptIdentifier(script)
+
+	scriptRateLimitersMutex.Lock()
+	if rps <= 0 {
+		delete(scriptRateLimiters, identifier)
+	} else {
+		scriptRateLimiters[identifier] = &ScriptHTTPRateLimit{RequestsPerSecond: rps, Burst: burst}
+	}
+	scriptRateLimitersMutex.Unlock()
+
+	log.Printf("✅ 脚本 HTTP 限流已更新: %s -> %.1f req/s, burst %.1f", script.Name, rps, burst)
+	return nil
+}
+
+// checkScriptHTTPRateLimit 对 (identifier, remoteIP) 做令牌桶限流
+func checkScriptHTTPRateLimit(identifier, remoteIP string) bool {
+	scriptRateLimitersMutex.RLock()
+	limit, exists := scriptRateLimiters[identifier]
+	scriptRateLimitersMutex.RUnlock()
+	if !exists {
+		limit = &defaultScriptHTTPRateLimit
+	}
+
+	key := identifier + "|" + remoteIP
+
+	rateLimitBucketsMutex.Lock()
+	defer rateLimitBucketsMutex.Unlock()
+
+	bucket, exists := rateLimitBuckets[key]
+	if !exists {
+		bucket = &tokenBucket{
+			tokens:     limit.Burst,
+			ratePerSec: limit.RequestsPerSecond,
+			burst:      limit.Burst,
+			lastRefill: time.Now(),
+		}
+		rateLimitBuckets[key] = bucket
+	}
+
+	return bucket.allow(time.Now())
+}
+
+// rateLimitBucketIdleTTL 令牌桶连续多久没有请求后视为闲置，允许被清理掉
+const rateLimitBucketIdleTTL = 10 * time.Minute
+
+// cleanupIdleScriptHTTPRateLimitBuckets 清理长时间没有请求的限流桶（防止按来源 IP 无限增长）
+func cleanupIdleScriptHTTPRateLimitBuckets() {
+	now := time.Now()
+
+	rateLimitBucketsMutex.Lock()
+	defer rateLimitBucketsMutex.Unlock()
+
+	expired := 0
+	for key, bucket := range rateLimitBuckets {
+		if now.Sub(bucket.lastRefill) > rateLimitBucketIdleTTL {
+			delete(rateLimitBuckets, key)
+			expired++
+		}
+	}
+	if expired > 0 {
+		log.Printf("🧹 清理了 %d 个闲置的脚本 HTTP 限流桶", expired)
+	}
+}
+
+// extractScriptHTTPToken 从请求中提取调用方携带的 Token（Authorization: Bearer 或 ?token=）
+func extractScriptHTTPToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if strings.HasPrefix(auth, "Bearer ") {
+			return strings.TrimPrefix(auth, "Bearer ")
+		}
+	}
+	return r.URL.Query().Get("token")
+}
+
+// constantTimeTokenEqual 以常数时间比较调用方提供的 Token 与预期值，避免逐字节比较泄露时序信息
+func constantTimeTokenEqual(provided, expected string) bool {
+	if len(provided) != len(expected) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) == 1
+}
+
+// remoteHost 从 RemoteAddr 中剥离端口，取出纯 IP
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// authenticateScriptHTTPRequest 校验请求的 Token、白名单与限流，失败时直接写响应并返回 false
+func authenticateScriptHTTPRequest(w http.ResponseWriter, r *http.Request, identifier string) bool {
+	remoteIP := remoteHost(r.RemoteAddr)
+
+	if !checkScriptHTTPACL(identifier, remoteIP) {
+		http.Error(w, "来源 IP 不在白名单内", http.StatusForbidden)
+		return false
+	}
+
+	scriptTokensMutex.RLock()
+	expected, hasToken := scriptTokens[identifier]
+	scriptTokensMutex.RUnlock()
+
+	if hasToken {
+		provided := extractScriptHTTPToken(r)
+		if provided == "" || !constantTimeTokenEqual(provided, expected) {
+			http.Error(w, "缺少或无效的 Token", http.StatusUnauthorized)
+			return false
+		}
+	}
+
+	if !checkScriptHTTPRateLimit(identifier, remoteIP) {
+		http.Error(w, "请求过于频繁，请稍后重试", http.StatusTooManyRequests)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// scriptHTTPAuthState 是 Token/白名单持久化到磁盘的结构，和脚本本身存放在同一个应用配置目录下
+type scriptHTTPAuthState struct {
+	Tokens map[string]string   `json:"tokens"`
+	ACLs   map[string][]string `json:"acls"`
+}
+
+var scriptHTTPAuthStateOnce sync.Once
+
+// scriptHTTPAuthStatePath 持久化文件路径：<配置目录>/clip-save/script-http-auth.json
+func scriptHTTPAuthStatePath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(configDir, "clip-save")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "script-http-auth.json"), nil
+}
+
+// loadScriptHTTPAuthStateOnce 进程内只从磁盘加载一次已持久化的 Token/白名单，避免每次重启都重新生成 Token
+func loadScriptHTTPAuthStateOnce() {
+	scriptHTTPAuthStateOnce.Do(func() {
+		path, err := scriptHTTPAuthStatePath()
+		if err != nil {
+			log.Printf("❌ 获取脚本 HTTP 认证数据持久化路径失败: %v", err)
+			return
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			// 首次运行时文件不存在，属于正常情况
+			return
+		}
+
+		var state scriptHTTPAuthState
+		if err := json.Unmarshal(data, &state); err != nil {
+			log.Printf("❌ 解析脚本 HTTP 认证持久化数据失败: %v", err)
+			return
+		}
+
+		scriptTokensMutex.Lock()
+		for identifier, token := range state.Tokens {
+			scriptTokens[identifier] = token
+		}
+		scriptTokensMutex.Unlock()
+
+		scriptACLsMutex.Lock()
+		for identifier, cidrs := range state.ACLs {
+			scriptACLs[identifier] = &ScriptHTTPACL{CIDRs: cidrs}
+		}
+		scriptACLsMutex.Unlock()
+
+		log.Printf("✅ 已从磁盘恢复 %d 个脚本的 HTTP Token", len(state.Tokens))
+	})
+}
+
+// saveScriptHTTPAuthState 把当前的 Token/白名单写回磁盘，使其在应用重启后仍然有效
+func saveScriptHTTPAuthState() {
+	path, err := scriptHTTPAuthStatePath()
+	if err != nil {
+		log.Printf("❌ 获取脚本 HTTP 认证数据持久化路径失败: %v", err)
+		return
+	}
+
+	scriptTokensMutex.RLock()
+	tokens := make(map[string]string, len(scriptTokens))
+	for identifier, token := range scriptTokens {
+		tokens[identifier] = token
+	}
+	scriptTokensMutex.RUnlock()
+
+	scriptACLsMutex.RLock()
+	acls := make(map[string][]string, len(scriptACLs))
+	for identifier, acl := range scriptACLs {
+		acls[identifier] = acl.CIDRs
+	}
+	scriptACLsMutex.RUnlock()
+
+	data, err := json.MarshalIndent(scriptHTTPAuthState{Tokens: tokens, ACLs: acls}, "", "  ")
+	if err != nil {
+		log.Printf("❌ 序列化脚本 HTTP 认证持久化数据失败: %v", err)
+		return
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		log.Printf("❌ 写入脚本 HTTP 认证持久化数据失败: %v", err)
+	}
+}
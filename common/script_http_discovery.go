@@ -0,0 +1,152 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/grandcat/zeroconf"
+)
+
+const scriptHTTPMDNSServiceType = "_clipsave._tcp"
+
+var (
+	scriptHTTPMDNSServers      = make(map[string]*zeroconf.Server) // identifier -> mDNS 广播实例
+	scriptHTTPMDNSServersMutex sync.Mutex
+)
+
+// advertiseScriptHTTPService 为单个脚本发布 mDNS/Bonjour 广播，已存在时先移除旧广播
+func advertiseScriptHTTPService(script *UserScript) {
+	identifier := GetScriptIdentifier(script)
+
+	stopScriptHTTPMDNS(identifier)
+
+	cfg := getScriptHTTPServerConfig()
+	_, portStr, err := splitHostPortDefault(cfg.Addr, "6527")
+	if err != nil {
+		log.Printf("❌ 解析脚本 HTTP 监听端口失败: %v", err)
+		return
+	}
+
+	port := 6527
+	if portStr != "" {
+		fmt.Sscanf(portStr, "%d", &port)
+	}
+
+	scheme := "http"
+	if cfg.TLS.Mode != "" && cfg.TLS.Mode != TLSModeOff {
+		scheme = "https"
+	}
+
+	txt := []string{
+		"identifier=" + identifier,
+		"name=" + script.Name,
+		"version=1",
+		"auth=bearer",
+		"scheme=" + scheme,
+	}
+
+	server, err := zeroconf.Register(identifier, scriptHTTPMDNSServiceType, "local.", port, txt, nil)
+	if err != nil {
+		log.Printf("❌ 脚本 HTTP mDNS 广播启动失败: %s: %v", identifier, err)
+		return
+	}
+
+	scriptHTTPMDNSServersMutex.Lock()
+	scriptHTTPMDNSServers[identifier] = server
+	scriptHTTPMDNSServersMutex.Unlock()
+
+	log.Printf("✅ 脚本 HTTP mDNS 广播已启动: %s -> %s.%s", identifier, identifier, scriptHTTPMDNSServiceType)
+}
+
+// stopScriptHTTPMDNS 停止某个脚本的 mDNS 广播
+func stopScriptHTTPMDNS(identifier string) {
+	scriptHTTPMDNSServersMutex.Lock()
+	server, exists := scriptHTTPMDNSServers[identifier]
+	if exists {
+		delete(scriptHTTPMDNSServers, identifier)
+	}
+	scriptHTTPMDNSServersMutex.Unlock()
+
+	if exists {
+		server.Shutdown()
+		log.Printf("✅ 脚本 HTTP mDNS 广播已停止: %s", identifier)
+	}
+}
+
+// stopAllScriptHTTPMDNS 停止所有脚本的 mDNS 广播（服务器整体关闭时调用）
+func stopAllScriptHTTPMDNS() {
+	scriptHTTPMDNSServersMutex.Lock()
+	servers := scriptHTTPMDNSServers
+	scriptHTTPMDNSServers = make(map[string]*zeroconf.Server)
+	scriptHTTPMDNSServersMutex.Unlock()
+
+	for identifier, server := range servers {
+		server.Shutdown()
+		log.Printf("✅ 脚本 HTTP mDNS 广播已停止: %s", identifier)
+	}
+}
+
+// ScriptHTTPPairingPayload 供 UI 渲染为二维码的配对信息
+type ScriptHTTPPairingPayload struct {
+	URL           string `json:"url"`
+	Token         string `json:"token"`
+	CAFingerprint string `json:"caFingerprint,omitempty"`
+	Identifier    string `json:"identifier"`
+}
+
+// GetScriptHTTPPairingPayload 返回可供二维码展示的精简配对信息（URL、Token、CA 指纹、标识符）
+func GetScriptHTTPPairingPayload(scriptID string) (string, error) {
+	script, err := GetUserScriptByID(scriptID)
+	if err != nil {
+		return "", fmt.Errorf("获取脚本失败: %v", err)
+	}
+
+	identifier := GetScriptIdentifier(script)
+
+	url, err := GetScriptHTTPURL(scriptID)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := ensureScriptHTTPToken(identifier)
+	if err != nil {
+		return "", err
+	}
+
+	payload := ScriptHTTPPairingPayload{
+		URL:        url,
+		Token:      token,
+		Identifier: identifier,
+	}
+
+	if ca, err := GetScriptHTTPServerCA(); err == nil {
+		if block, _ := pem.Decode(ca); block != nil {
+			sum := sha256.Sum256(block.Bytes)
+			payload.CAFingerprint = hex.EncodeToString(sum[:])
+		}
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("序列化配对信息失败: %v", err)
+	}
+	return string(data), nil
+}
+
+// splitHostPortDefault 解析形如 ":6527" 或 "0.0.0.0:6527" 的地址，端口缺省时使用 defaultPort
+func splitHostPortDefault(addr, defaultPort string) (host, port string, err error) {
+	if addr == "" {
+		return "", defaultPort, nil
+	}
+	for i := len(addr) - 1; i >= 0; i-- {
+		if addr[i] == ':' {
+			return addr[:i], addr[i+1:], nil
+		}
+	}
+	return addr, defaultPort, nil
+}
@@ -0,0 +1,294 @@
+package common
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Route 描述一个已启用脚本对应的 HTTP 路由
+type Route struct {
+	Identifier    string
+	Script        *UserScript
+	Methods       []string
+	ContentSchema string
+	Timeout       time.Duration
+	Middleware    []Middleware
+}
+
+// ScriptHTTPHandlerFunc 路由最终的处理函数，携带命中的 Route
+type ScriptHTTPHandlerFunc func(w http.ResponseWriter, r *http.Request, route *Route)
+
+// Middleware 包装一个 ScriptHTTPHandlerFunc，在其前后插入横切逻辑
+type Middleware func(next ScriptHTTPHandlerFunc) ScriptHTTPHandlerFunc
+
+// RouteRegistry 管理所有已启用脚本的路由，取代原先扁平的 enabledScripts map
+type RouteRegistry struct {
+	mu     sync.RWMutex
+	routes map[string]*Route
+}
+
+var routeRegistry = &RouteRegistry{routes: make(map[string]*Route)}
+
+// Register 注册或更新一条路由
+func (reg *RouteRegistry) Register(route *Route) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.routes[route.Identifier] = route
+}
+
+// Unregister 移除一条路由
+func (reg *RouteRegistry) Unregister(identifier string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	delete(reg.routes, identifier)
+}
+
+// Get 按标识符查找路由
+func (reg *RouteRegistry) Get(identifier string) (*Route, bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	route, exists := reg.routes[identifier]
+	return route, exists
+}
+
+// List 返回当前所有路由的快照
+func (reg *RouteRegistry) List() []*Route {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	routes := make([]*Route, 0, len(reg.routes))
+	for _, route := range reg.routes {
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+var (
+	namedMiddlewares      = make(map[string]Middleware)
+	namedMiddlewaresMutex sync.RWMutex
+)
+
+// RegisterMiddleware 注册一个可按名引用的中间件，供 Go 侧集成（未来也包括 JS 插件）注入处理逻辑
+func RegisterMiddleware(name string, fn Middleware) {
+	namedMiddlewaresMutex.Lock()
+	defer namedMiddlewaresMutex.Unlock()
+	namedMiddlewares[name] = fn
+}
+
+// GetMiddleware 按名字查找已注册的中间件
+func GetMiddleware(name string) (Middleware, bool) {
+	namedMiddlewaresMutex.RLock()
+	defer namedMiddlewaresMutex.RUnlock()
+	fn, exists := namedMiddlewares[name]
+	return fn, exists
+}
+
+// defaultMiddlewareChain 默认中间件链。accessLog/metrics 包裹在 auth/rateLimit 外层，
+// 这样被拒绝的请求（401/403/429）也会被记录和计数，而不只是放行的请求
+func defaultMiddlewareChain() []Middleware {
+	return []Middleware{
+		recoverMiddleware,
+		corsMiddleware,
+		traceIDMiddleware,
+		accessLogMiddleware,
+		metricsMiddleware,
+		authMiddleware,
+		rateLimitMiddleware,
+	}
+}
+
+// applyMiddlewareChain 按顺序把中间件包裹到最终处理函数外层（链表头先执行）
+func applyMiddlewareChain(chain []Middleware, final ScriptHTTPHandlerFunc) ScriptHTTPHandlerFunc {
+	handler := final
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+	}
+	return handler
+}
+
+// recoverMiddleware 捕获处理链中的 panic，避免单个请求拖垮整个服务器
+func recoverMiddleware(next ScriptHTTPHandlerFunc) ScriptHTTPHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, route *Route) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Printf("❌ 脚本 HTTP 请求处理 panic: %v", rec)
+				http.Error(w, "服务器内部错误", http.StatusInternalServerError)
+			}
+		}()
+		next(w, r, route)
+	}
+}
+
+// corsMiddleware 设置 CORS 响应头，并短路 OPTIONS 预检请求
+func corsMiddleware(next ScriptHTTPHandlerFunc) ScriptHTTPHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, route *Route) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		next(w, r, route)
+	}
+}
+
+type traceIDContextKey struct{}
+
+// traceIDMiddleware 为每个请求生成一个用于日志关联的 trace id，并写入响应头
+func traceIDMiddleware(next ScriptHTTPHandlerFunc) ScriptHTTPHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, route *Route) {
+		traceID := generateScriptHTTPTraceID()
+		w.Header().Set("X-Trace-Id", traceID)
+		r = r.WithContext(context.WithValue(r.Context(), traceIDContextKey{}, traceID))
+		next(w, r, route)
+	}
+}
+
+// generateScriptHTTPTraceID 生成一个短随机 trace id
+func generateScriptHTTPTraceID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("t%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// traceIDFromContext 读取 traceIDMiddleware 写入的 trace id
+func traceIDFromContext(r *http.Request) string {
+	if v, ok := r.Context().Value(traceIDContextKey{}).(string); ok {
+		return v
+	}
+	return "-"
+}
+
+// authMiddleware 校验 Token 与 IP 白名单（限流单独拆分到 rateLimitMiddleware）
+func authMiddleware(next ScriptHTTPHandlerFunc) ScriptHTTPHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, route *Route) {
+		remoteIP := remoteHost(r.RemoteAddr)
+
+		if !checkScriptHTTPACL(route.Identifier, remoteIP) {
+			http.Error(w, "来源 IP 不在白名单内", http.StatusForbidden)
+			return
+		}
+
+		scriptTokensMutex.RLock()
+		expected, hasToken := scriptTokens[route.Identifier]
+		scriptTokensMutex.RUnlock()
+
+		if hasToken {
+			provided := extractScriptHTTPToken(r)
+			if provided == "" || !constantTimeTokenEqual(provided, expected) {
+				http.Error(w, "缺少或无效的 Token", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		next(w, r, route)
+	}
+}
+
+// rateLimitMiddleware 对 (identifier, remoteIP) 做令牌桶限流
+func rateLimitMiddleware(next ScriptHTTPHandlerFunc) ScriptHTTPHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, route *Route) {
+		remoteIP := remoteHost(r.RemoteAddr)
+		if !checkScriptHTTPRateLimit(route.Identifier, remoteIP) {
+			http.Error(w, "请求过于频繁，请稍后重试", http.StatusTooManyRequests)
+			return
+		}
+		next(w, r, route)
+	}
+}
+
+// statusCapturingWriter 包装 http.ResponseWriter 以记录状态码与写出的字节数
+type statusCapturingWriter struct {
+	http.ResponseWriter
+	status      int
+	bytesOut    int
+	wroteHeader bool
+}
+
+func (w *statusCapturingWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusCapturingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.status = http.StatusOK
+		w.wroteHeader = true
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytesOut += n
+	return n, err
+}
+
+// accessLogMiddleware 记录结构化访问日志：trace id、标识符、耗时、状态码、出入字节数
+func accessLogMiddleware(next ScriptHTTPHandlerFunc) ScriptHTTPHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, route *Route) {
+		start := time.Now()
+		sw := &statusCapturingWriter{ResponseWriter: w}
+
+		next(sw, r, route)
+
+		log.Printf("📝 [%s] %s /clip-save/%s status=%d bytesIn=%d bytesOut=%d duration=%s",
+			traceIDFromContext(r), r.Method, route.Identifier, sw.status, r.ContentLength, sw.bytesOut, time.Since(start))
+	}
+}
+
+// scriptHTTPMetric 每个标识符累计的请求数与耗时，供基础指标查询
+type scriptHTTPMetric struct {
+	Count        int64
+	TotalLatency time.Duration
+}
+
+var (
+	scriptHTTPMetrics      = make(map[string]*scriptHTTPMetric)
+	scriptHTTPMetricsMutex sync.Mutex
+)
+
+// metricsMiddleware 累计每个标识符的请求次数与耗时
+func metricsMiddleware(next ScriptHTTPHandlerFunc) ScriptHTTPHandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, route *Route) {
+		start := time.Now()
+		next(w, r, route)
+		elapsed := time.Since(start)
+
+		scriptHTTPMetricsMutex.Lock()
+		m, exists := scriptHTTPMetrics[route.Identifier]
+		if !exists {
+			m = &scriptHTTPMetric{}
+			scriptHTTPMetrics[route.Identifier] = m
+		}
+		m.Count++
+		m.TotalLatency += elapsed
+		scriptHTTPMetricsMutex.Unlock()
+	}
+}
+
+// GetScriptHTTPMetrics 返回某个脚本累计的请求数与平均耗时（毫秒）
+func GetScriptHTTPMetrics(scriptID string) (count int64, avgLatencyMs float64, err error) {
+	script, err := GetUserScriptByID(scriptID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("获取脚本失败: %v", err)
+	}
+	identifier := GetScriptIdentifier(script)
+
+	scriptHTTPMetricsMutex.Lock()
+	defer scriptHTTPMetricsMutex.Unlock()
+
+	m, exists := scriptHTTPMetrics[identifier]
+	if !exists || m.Count == 0 {
+		return 0, 0, nil
+	}
+	return m.Count, float64(m.TotalLatency.Milliseconds()) / float64(m.Count), nil
+}
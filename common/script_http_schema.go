@@ -0,0 +1,335 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 脚本 HTTP 请求体 schema，脚本通过 script.http.schema 字段声明，默认 free-form
+const (
+	ScriptHTTPSchemaFreeForm  = "free-form" // 单个字符串字段 content（历史行为）
+	ScriptHTTPSchemaJSON      = "json"      // 任意 JSON body
+	ScriptHTTPSchemaMultipart = "multipart" // multipart/form-data，文件落盘为临时文件
+	ScriptHTTPSchemaBinary    = "binary"    // application/octet-stream 原始字节
+	ScriptHTTPSchemaImage     = "image"     // image/* 自动解析出元数据
+)
+
+// scriptHTTPSchemaFor 读取脚本通过 script.http.schema 声明的请求体 schema，未声明或值非法时回退到 free-form
+func scriptHTTPSchemaFor(script *UserScript) string {
+	if script.Config != nil {
+		if v, ok := script.Config["http.schema"].(string); ok && v != "" {
+			switch v {
+			case ScriptHTTPSchemaFreeForm, ScriptHTTPSchemaJSON, ScriptHTTPSchemaMultipart, ScriptHTTPSchemaBinary, ScriptHTTPSchemaImage:
+				return v
+			default:
+				log.Printf("⚠️ 脚本 %s 声明了未知的 http.schema: %s，回退为 free-form", script.Name, v)
+			}
+		}
+	}
+	return ScriptHTTPSchemaFreeForm
+}
+
+// ScriptHTTPFile 描述一个通过 multipart 上传并落盘的文件
+type ScriptHTTPFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	Path string `json:"path"`
+	Mime string `json:"mime"`
+}
+
+// ScriptHTTPImageInfo 描述自动解码出的图片元数据
+type ScriptHTTPImageInfo struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Format string `json:"format"`
+	Size   int64  `json:"size"`
+	Path   string `json:"path"`
+	Mime   string `json:"mime"`
+}
+
+// parseScriptHTTPPayload 按 route 声明的 schema 解析请求体，返回拼入 script.http.execute 事件的额外字段
+func parseScriptHTTPPayload(w http.ResponseWriter, r *http.Request, route *Route) (map[string]interface{}, bool) {
+	schema := route.ContentSchema
+	if schema == "" {
+		schema = ScriptHTTPSchemaFreeForm
+	}
+
+	switch schema {
+	case ScriptHTTPSchemaFreeForm:
+		return parseScriptHTTPFreeForm(w, r)
+	case ScriptHTTPSchemaJSON:
+		return parseScriptHTTPJSON(w, r)
+	case ScriptHTTPSchemaMultipart:
+		return parseScriptHTTPMultipart(w, r)
+	case ScriptHTTPSchemaBinary:
+		return parseScriptHTTPBinary(w, r)
+	case ScriptHTTPSchemaImage:
+		return parseScriptHTTPImage(w, r)
+	default:
+		http.Error(w, fmt.Sprintf("未知的请求 schema: %s", schema), http.StatusBadRequest)
+		return nil, false
+	}
+}
+
+// parseScriptHTTPFreeForm 历史行为：GET 查询参数 / JSON {content} / 表单 content
+func parseScriptHTTPFreeForm(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	var content string
+	if r.Method == "GET" {
+		content = r.URL.Query().Get("content")
+	} else if r.Method == "POST" {
+		contentType := r.Header.Get("Content-Type")
+		if strings.Contains(contentType, "application/json") {
+			var jsonData map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&jsonData); err != nil {
+				http.Error(w, fmt.Sprintf("解析 JSON 失败: %v", err), http.StatusBadRequest)
+				return nil, false
+			}
+			if val, ok := jsonData["content"].(string); ok {
+				content = val
+			}
+		} else {
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, fmt.Sprintf("解析表单失败: %v", err), http.StatusBadRequest)
+				return nil, false
+			}
+			content = r.FormValue("content")
+		}
+	} else {
+		http.Error(w, "不支持的 HTTP 方法", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	return map[string]interface{}{"content": content}, true
+}
+
+// parseScriptHTTPJSON 把整个请求体作为任意 JSON 传给脚本
+func parseScriptHTTPJSON(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	var payload interface{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, fmt.Sprintf("解析 JSON 失败: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+	return map[string]interface{}{"payload": payload}, true
+}
+
+// parseScriptHTTPMultipart 解析 multipart/form-data，文件落盘为临时文件，其余字段作为 fields 传给脚本
+func parseScriptHTTPMultipart(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, fmt.Sprintf("解析 multipart 失败: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+	// ParseMultipartForm 超过内存阈值时会把文件落到系统临时目录，这里的内容已经被
+	// saveScriptHTTPUpload 复制走，原始临时文件可以立即清理
+	defer r.MultipartForm.RemoveAll()
+
+	files := make([]ScriptHTTPFile, 0)
+	for _, headers := range r.MultipartForm.File {
+		for _, header := range headers {
+			path, size, err := saveScriptHTTPUpload(header)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("保存上传文件失败: %v", err), http.StatusInternalServerError)
+				return nil, false
+			}
+			files = append(files, ScriptHTTPFile{
+				Name: header.Filename,
+				Size: size,
+				Path: path,
+				Mime: header.Header.Get("Content-Type"),
+			})
+		}
+	}
+
+	fields := make(map[string]interface{})
+	for key, values := range r.MultipartForm.Value {
+		if len(values) == 1 {
+			fields[key] = values[0]
+		} else {
+			fields[key] = values
+		}
+	}
+
+	return map[string]interface{}{"files": files, "fields": fields}, true
+}
+
+// parseScriptHTTPBinary 读取原始二进制 body，以 base64 传给脚本
+func parseScriptHTTPBinary(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("读取请求体失败: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	return map[string]interface{}{
+		"contentType": r.Header.Get("Content-Type"),
+		"content":     base64.StdEncoding.EncodeToString(data),
+		"size":        len(data),
+	}, true
+}
+
+// parseScriptHTTPImage 读取 image/* body，解析宽高与格式后落盘，返回元数据
+func parseScriptHTTPImage(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("读取请求体失败: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	decodedCfg, decodedFormat, decodeErr := decodeImageConfig(data)
+	if decodeErr != nil {
+		http.Error(w, fmt.Sprintf("解析图片失败: %v", decodeErr), http.StatusBadRequest)
+		return nil, false
+	}
+
+	path, size, err := saveScriptHTTPBytes(data, "upload-*."+decodedFormat)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("保存图片失败: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	info := ScriptHTTPImageInfo{
+		Width:  decodedCfg.Width,
+		Height: decodedCfg.Height,
+		Format: decodedFormat,
+		Size:   size,
+		Path:   path,
+		Mime:   r.Header.Get("Content-Type"),
+	}
+	return map[string]interface{}{"image": info}, true
+}
+
+// decodeImageConfig 从已读入内存的字节中解析图片宽高与格式
+func decodeImageConfig(data []byte) (image.Config, string, error) {
+	return image.DecodeConfig(bytes.NewReader(data))
+}
+
+// saveScriptHTTPUpload 把 multipart 文件 header 落盘到临时目录
+func saveScriptHTTPUpload(header *multipart.FileHeader) (path string, size int64, err error) {
+	src, err := header.Open()
+	if err != nil {
+		return "", 0, err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return saveScriptHTTPBytes(data, "upload-*-"+sanitizeScriptHTTPFilename(header.Filename))
+}
+
+// saveScriptHTTPBytes 把字节内容落盘到系统临时目录下的 clip-save-script-http 子目录
+func saveScriptHTTPBytes(data []byte, pattern string) (path string, size int64, err error) {
+	dir := filepath.Join(os.TempDir(), "clip-save-script-http")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", 0, fmt.Errorf("创建临时目录失败: %v", err)
+	}
+
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	n, err := f.Write(data)
+	if err != nil {
+		return "", 0, err
+	}
+	return f.Name(), int64(n), nil
+}
+
+// scriptHTTPUploadTTL 落盘的上传文件/图片距最后修改时间超过多久就视为可清理
+const scriptHTTPUploadTTL = 10 * time.Minute
+
+// cleanupExpiredScriptHTTPUploads 定期清理 clip-save-script-http 临时目录下的过期文件，防止无限增长
+func cleanupExpiredScriptHTTPUploads() {
+	dir := filepath.Join(os.TempDir(), "clip-save-script-http")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	removed := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if now.Sub(info.ModTime()) > scriptHTTPUploadTTL {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err == nil {
+				removed++
+			}
+		}
+	}
+	if removed > 0 {
+		log.Printf("🧹 清理了 %d 个过期的脚本 HTTP 上传临时文件", removed)
+	}
+}
+
+// sanitizeScriptHTTPFilename 去掉路径分隔符，避免 CreateTemp 的 pattern 里混入目录结构
+func sanitizeScriptHTTPFilename(name string) string {
+	name = filepath.Base(name)
+	return strings.ReplaceAll(name, "*", "_")
+}
+
+// writeScriptHTTPResponse 把脚本执行结果写回 HTTP 响应；returnValue 可携带 {contentType, body, headers, status} 自定义响应，否则退化为旧的 JSON 信封
+func writeScriptHTTPResponse(w http.ResponseWriter, result ScriptHTTPResult) {
+	if result.Error != "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": result.Error})
+		return
+	}
+
+	if custom, ok := result.ReturnValue.(map[string]interface{}); ok {
+		if _, hasBody := custom["body"]; hasBody {
+			writeScriptHTTPCustomResponse(w, custom)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"returnValue": result.ReturnValue})
+}
+
+// writeScriptHTTPCustomResponse 按脚本声明的 contentType/headers/status 写出自定义响应体
+func writeScriptHTTPCustomResponse(w http.ResponseWriter, custom map[string]interface{}) {
+	if headers, ok := custom["headers"].(map[string]interface{}); ok {
+		for key, value := range headers {
+			if str, ok := value.(string); ok {
+				w.Header().Set(key, str)
+			}
+		}
+	}
+
+	if contentType, ok := custom["contentType"].(string); ok && contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	status := http.StatusOK
+	if s, ok := custom["status"].(float64); ok {
+		status = int(s)
+	}
+	w.WriteHeader(status)
+
+	switch body := custom["body"].(type) {
+	case string:
+		io.WriteString(w, body)
+	default:
+		json.NewEncoder(w).Encode(body)
+	}
+}
@@ -1,7 +1,6 @@
 package common
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"net"
@@ -14,8 +13,6 @@ import (
 var (
 	httpServer          *http.Server
 	httpServerMutex     sync.RWMutex
-	enabledScripts      = make(map[string]*UserScript) // identifier -> script
-	enabledScriptsMutex sync.RWMutex
 	scriptResults       = make(map[string]chan ScriptHTTPResult) // requestID -> result channel
 	scriptResultsMutex  sync.RWMutex
 	requestCounter      int64
@@ -63,9 +60,17 @@ func StartScriptHTTPServer() error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/clip-save/", handleScriptHTTPRequest)
 
+	cfg := getScriptHTTPServerConfig()
+
+	tlsConfig, err := buildScriptHTTPTLSConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("配置 TLS 失败: %v", err)
+	}
+
 	httpServer = &http.Server{
-		Addr:    ":6527",
-		Handler: mux,
+		Addr:      cfg.Addr,
+		Handler:   buildScriptHTTPHandler(cfg, mux),
+		TLSConfig: tlsConfig,
 	}
 
 	// 启动定期清理任务（每 5 分钟清理一次超时的结果通道）
@@ -74,12 +79,18 @@ func StartScriptHTTPServer() error {
 	go cleanupExpiredResults()
 
 	go func() {
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("❌ 脚本 HTTP 服务器启动失败: %v", err)
+		var serveErr error
+		if tlsConfig != nil {
+			serveErr = httpServer.ListenAndServeTLS("", "")
+		} else {
+			serveErr = httpServer.ListenAndServe()
+		}
+		if serveErr != nil && serveErr != http.ErrServerClosed {
+			log.Printf("❌ 脚本 HTTP 服务器启动失败: %v", serveErr)
 		}
 	}()
 
-	log.Printf("✅ 脚本 HTTP 服务器已启动，端口: 6527")
+	log.Printf("✅ 脚本 HTTP 服务器已启动，监听: %s (TLS: %s)", cfg.Addr, cfg.TLS.Mode)
 	return nil
 }
 
@@ -106,6 +117,8 @@ func StopScriptHTTPServer() error {
 		return fmt.Errorf("停止 HTTP 服务器失败: %v", err)
 	}
 
+	stopAllScriptHTTPMDNS()
+
 	// 清理所有结果通道
 	scriptResultsMutex.Lock()
 	for requestID, resultChan := range scriptResults {
@@ -148,6 +161,10 @@ func cleanupExpiredResults() {
 			if expiredCount > 0 {
 				log.Printf("🧹 清理了 %d 个过期的脚本执行结果通道", expiredCount)
 			}
+
+			cleanupDeadScriptHTTPWebSockets()
+			cleanupIdleScriptHTTPRateLimitBuckets()
+			cleanupExpiredScriptHTTPUploads()
 		}
 	}
 }
@@ -161,10 +178,19 @@ func EnableScriptHTTPService(scriptID string) error {
 
 	identifier := GetScriptIdentifier(script)
 
-	enabledScriptsMutex.Lock()
-	defer enabledScriptsMutex.Unlock()
-
-	enabledScripts[identifier] = script
+	routeRegistry.Register(&Route{
+		Identifier:    identifier,
+		Script:        script,
+		Methods:       []string{"GET", "POST"},
+		ContentSchema: scriptHTTPSchemaFor(script),
+		Timeout:       30 * time.Second,
+		Middleware:    defaultMiddlewareChain(),
+	})
+
+	// 为脚本生成（或复用）API Token
+	if _, err := ensureScriptHTTPToken(identifier); err != nil {
+		return fmt.Errorf("生成 API Token 失败: %v", err)
+	}
 
 	// 如果服务器未启动，启动它
 	httpServerMutex.RLock()
@@ -177,6 +203,9 @@ func EnableScriptHTTPService(scriptID string) error {
 		}
 	}
 
+	// 发布 mDNS 广播，便于配套 App 自动发现
+	advertiseScriptHTTPService(script)
+
 	log.Printf("✅ 脚本 HTTP 服务已启用: %s -> /clip-save/%s", script.Name, identifier)
 	return nil
 }
@@ -190,10 +219,21 @@ func DisableScriptHTTPService(scriptID string) error {
 
 	identifier := GetScriptIdentifier(script)
 
-	enabledScriptsMutex.Lock()
-	defer enabledScriptsMutex.Unlock()
+	loadScriptHTTPAuthStateOnce()
+
+	routeRegistry.Unregister(identifier)
+
+	scriptTokensMutex.Lock()
+	delete(scriptTokens, identifier)
+	scriptTokensMutex.Unlock()
 
-	delete(enabledScripts, identifier)
+	scriptACLsMutex.Lock()
+	delete(scriptACLs, identifier)
+	scriptACLsMutex.Unlock()
+
+	saveScriptHTTPAuthState()
+
+	stopScriptHTTPMDNS(identifier)
 
 	log.Printf("✅ 脚本 HTTP 服务已禁用: %s -> /clip-save/%s", script.Name, identifier)
 	return nil
@@ -208,10 +248,7 @@ func IsScriptHTTPServiceEnabled(scriptID string) bool {
 
 	identifier := GetScriptIdentifier(script)
 
-	enabledScriptsMutex.RLock()
-	defer enabledScriptsMutex.RUnlock()
-
-	_, exists := enabledScripts[identifier]
+	_, exists := routeRegistry.Get(identifier)
 	return exists
 }
 
@@ -230,7 +267,22 @@ func GetScriptHTTPURL(scriptID string) (string, error) {
 		return "", fmt.Errorf("获取本机 IP 失败: %v", err)
 	}
 
-	return fmt.Sprintf("http://%s:6527/clip-save/%s?content=xx", ip, identifier), nil
+	token, err := ensureScriptHTTPToken(identifier)
+	if err != nil {
+		return "", fmt.Errorf("获取 API Token 失败: %v", err)
+	}
+
+	cfg := getScriptHTTPServerConfig()
+	scheme := "http"
+	if cfg.TLS.Mode != "" && cfg.TLS.Mode != TLSModeOff {
+		scheme = "https"
+	}
+	_, port, err := splitHostPortDefault(cfg.Addr, "6527")
+	if err != nil {
+		return "", fmt.Errorf("解析监听端口失败: %v", err)
+	}
+
+	return fmt.Sprintf("%s://%s:%s/clip-save/%s?content=xx&token=%s", scheme, ip, port, identifier, token), nil
 }
 
 // getLocalIP 获取本机局域网 IP
@@ -245,18 +297,8 @@ func getLocalIP() (string, error) {
 	return localAddr.IP.String(), nil
 }
 
-// handleScriptHTTPRequest 处理脚本 HTTP 请求
+// handleScriptHTTPRequest 处理脚本 HTTP 请求：查路由表，套中间件链，交给 executeScriptHTTPRoute
 func handleScriptHTTPRequest(w http.ResponseWriter, r *http.Request) {
-	// 设置 CORS 头
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == "OPTIONS" {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-
 	// 提取路径中的 identifier
 	path := strings.TrimPrefix(r.URL.Path, "/clip-save/")
 	if path == "" {
@@ -264,42 +306,39 @@ func handleScriptHTTPRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 查找对应的脚本
-	enabledScriptsMutex.RLock()
-	script, exists := enabledScripts[path]
-	enabledScriptsMutex.RUnlock()
+	// /clip-save/<identifier>/ws 走 WebSocket 升级，不经过普通路由中间件链
+	if identifier, isWS := isScriptHTTPWebSocketPath(path); isWS {
+		route, exists := routeRegistry.Get(identifier)
+		if !exists {
+			http.Error(w, "脚本未启用 HTTP 服务", http.StatusNotFound)
+			return
+		}
+		handleScriptHTTPWebSocket(w, r, identifier, route.Script)
+		return
+	}
 
+	route, exists := routeRegistry.Get(path)
 	if !exists {
 		http.Error(w, "脚本未启用 HTTP 服务", http.StatusNotFound)
 		return
 	}
 
-	// 提取 content 参数
-	var content string
-	if r.Method == "GET" {
-		content = r.URL.Query().Get("content")
-	} else if r.Method == "POST" {
-		contentType := r.Header.Get("Content-Type")
-		if strings.Contains(contentType, "application/json") {
-			// JSON 格式
-			var jsonData map[string]interface{}
-			if err := json.NewDecoder(r.Body).Decode(&jsonData); err != nil {
-				http.Error(w, fmt.Sprintf("解析 JSON 失败: %v", err), http.StatusBadRequest)
-				return
-			}
-			if val, ok := jsonData["content"].(string); ok {
-				content = val
-			}
-		} else {
-			// 表单格式
-			if err := r.ParseForm(); err != nil {
-				http.Error(w, fmt.Sprintf("解析表单失败: %v", err), http.StatusBadRequest)
-				return
-			}
-			content = r.FormValue("content")
-		}
-	} else {
-		http.Error(w, "不支持的 HTTP 方法", http.StatusMethodNotAllowed)
+	chain := route.Middleware
+	if len(chain) == 0 {
+		chain = defaultMiddlewareChain()
+	}
+
+	handler := applyMiddlewareChain(chain, executeScriptHTTPRoute)
+	handler(w, r, route)
+}
+
+// executeScriptHTTPRoute 路由命中、中间件链通过后的核心逻辑：按 schema 解析请求体、触发脚本执行、等待结果
+func executeScriptHTTPRoute(w http.ResponseWriter, r *http.Request, route *Route) {
+	script := route.Script
+
+	// 按路由声明的 schema 解析请求体（free-form/json/multipart/binary/image）
+	payload, ok := parseScriptHTTPPayload(w, r, route)
+	if !ok {
 		return
 	}
 
@@ -315,19 +354,27 @@ func handleScriptHTTPRequest(w http.ResponseWriter, r *http.Request) {
 	scriptResults[requestID] = resultChan
 	scriptResultsMutex.Unlock()
 
-	// 通过事件触发脚本执行
+	// 通过事件触发脚本执行，payload 中携带按 schema 解析出的字段（content/payload/files/image 等）
 	if globalScriptEventCallback != nil {
-		globalScriptEventCallback("script.http.execute", map[string]interface{}{
+		event := map[string]interface{}{
 			"requestID": requestID,
 			"scriptID":  script.ID,
-			"content":   content,
-		})
+		}
+		for key, value := range payload {
+			event[key] = value
+		}
+		globalScriptEventCallback("script.http.execute", event)
 	} else {
 		http.Error(w, "脚本执行器未初始化", http.StatusInternalServerError)
 		return
 	}
 
-	// 等待脚本执行结果（超时 30 秒）
+	timeout := route.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	// 等待脚本执行结果
 	select {
 	case result := <-resultChan:
 		// 清理结果通道
@@ -335,18 +382,9 @@ func handleScriptHTTPRequest(w http.ResponseWriter, r *http.Request) {
 		delete(scriptResults, requestID)
 		scriptResultsMutex.Unlock()
 
-		// 返回结果
-		w.Header().Set("Content-Type", "application/json")
-		if result.Error != "" {
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"error": result.Error,
-			})
-		} else {
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"returnValue": result.ReturnValue,
-			})
-		}
-	case <-time.After(30 * time.Second):
+		// 返回结果：returnValue 可携带 {contentType, body, headers, status} 自定义响应，否则退化为 JSON 信封
+		writeScriptHTTPResponse(w, result)
+	case <-time.After(timeout):
 		// 超时
 		scriptResultsMutex.Lock()
 		delete(scriptResults, requestID)
@@ -358,6 +396,11 @@ func handleScriptHTTPRequest(w http.ResponseWriter, r *http.Request) {
 
 // SetScriptHTTPResult 设置脚本执行结果（由前端调用）
 func SetScriptHTTPResult(requestID string, result ScriptHTTPResult) {
+	// 如果该请求来自 WebSocket 连接，直接把结果推回对应的连接
+	if finishScriptHTTPWebSocketRequest(requestID, result) {
+		return
+	}
+
 	scriptResultsMutex.RLock()
 	resultChan, exists := scriptResults[requestID]
 	scriptResultsMutex.RUnlock()
@@ -0,0 +1,308 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// TLS 模式
+const (
+	TLSModeOff         = "off"         // 明文 HTTP
+	TLSModeSelfSigned  = "self-signed" // 本地自签名 CA + 叶子证书
+	TLSModeProvided    = "provided"    // 使用调用方提供的证书文件
+	scriptHTTPCertDir  = "script-http-tls"
+	scriptHTTPCAName   = "ca.pem"
+	scriptHTTPCAKey    = "ca.key.pem"
+	scriptHTTPLeafName = "leaf.pem"
+	scriptHTTPLeafKey  = "leaf.key.pem"
+)
+
+// ScriptHTTPTLSConfig 脚本 HTTP 服务器的 TLS 配置
+type ScriptHTTPTLSConfig struct {
+	Mode     string `json:"mode"`
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+}
+
+// ScriptHTTPServerConfig 脚本 HTTP 服务器的可配置项
+type ScriptHTTPServerConfig struct {
+	Addr string              `json:"addr"`
+	TLS  ScriptHTTPTLSConfig `json:"tls"`
+	H2C  bool                `json:"h2c"`
+}
+
+// defaultScriptHTTPServerConfig 默认配置：明文 HTTP，沿用历史端口
+func defaultScriptHTTPServerConfig() ScriptHTTPServerConfig {
+	return ScriptHTTPServerConfig{
+		Addr: ":6527",
+		TLS:  ScriptHTTPTLSConfig{Mode: TLSModeOff},
+	}
+}
+
+var (
+	scriptHTTPServerConfig      = defaultScriptHTTPServerConfig()
+	scriptHTTPServerConfigMutex sync.RWMutex
+
+	scriptHTTPCAPEM      []byte
+	scriptHTTPCAPEMMutex sync.RWMutex
+)
+
+// ConfigureScriptHTTPServer 配置脚本 HTTP 服务器的监听地址与 TLS 选项，需在 StartScriptHTTPServer 之前调用才会生效
+func ConfigureScriptHTTPServer(cfg ScriptHTTPServerConfig) error {
+	if cfg.Addr == "" {
+		cfg.Addr = ":6527"
+	}
+	switch cfg.TLS.Mode {
+	case "", TLSModeOff, TLSModeSelfSigned, TLSModeProvided:
+	default:
+		return fmt.Errorf("未知的 TLS 模式: %s", cfg.TLS.Mode)
+	}
+
+	httpServerMutex.RLock()
+	running := httpServer != nil
+	httpServerMutex.RUnlock()
+	if running {
+		return fmt.Errorf("请在启动 HTTP 服务器前完成配置")
+	}
+
+	scriptHTTPServerConfigMutex.Lock()
+	scriptHTTPServerConfig = cfg
+	scriptHTTPServerConfigMutex.Unlock()
+	return nil
+}
+
+// getScriptHTTPServerConfig 获取当前生效的服务器配置
+func getScriptHTTPServerConfig() ScriptHTTPServerConfig {
+	scriptHTTPServerConfigMutex.RLock()
+	defer scriptHTTPServerConfigMutex.RUnlock()
+	return scriptHTTPServerConfig
+}
+
+// GetScriptHTTPServerCA 返回当前自签名 CA 的 PEM 内容，供前端提供一键下载以便用户信任
+func GetScriptHTTPServerCA() ([]byte, error) {
+	scriptHTTPCAPEMMutex.RLock()
+	ca := scriptHTTPCAPEM
+	scriptHTTPCAPEMMutex.RUnlock()
+
+	if len(ca) > 0 {
+		return ca, nil
+	}
+
+	dir, err := scriptHTTPCertConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, scriptHTTPCAName))
+	if err != nil {
+		return nil, fmt.Errorf("CA 尚未生成: %v", err)
+	}
+	return data, nil
+}
+
+// scriptHTTPCertConfigDir 证书持久化目录
+func scriptHTTPCertConfigDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("获取配置目录失败: %v", err)
+	}
+	dir := filepath.Join(configDir, "clip-save", scriptHTTPCertDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("创建证书目录失败: %v", err)
+	}
+	return dir, nil
+}
+
+// buildScriptHTTPTLSConfig 根据配置构造 *tls.Config，off 模式返回 nil
+func buildScriptHTTPTLSConfig(cfg ScriptHTTPServerConfig) (*tls.Config, error) {
+	switch cfg.TLS.Mode {
+	case "", TLSModeOff:
+		return nil, nil
+	case TLSModeProvided:
+		cert, err := tls.LoadX509KeyPair(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载证书失败: %v", err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2", "http/1.1"}}, nil
+	case TLSModeSelfSigned:
+		cert, caPEM, err := ensureScriptHTTPSelfSignedCert()
+		if err != nil {
+			return nil, err
+		}
+		scriptHTTPCAPEMMutex.Lock()
+		scriptHTTPCAPEM = caPEM
+		scriptHTTPCAPEMMutex.Unlock()
+		return &tls.Config{Certificates: []tls.Certificate{*cert}, NextProtos: []string{"h2", "http/1.1"}}, nil
+	default:
+		return nil, fmt.Errorf("未知的 TLS 模式: %s", cfg.TLS.Mode)
+	}
+}
+
+// ensureScriptHTTPSelfSignedCert 加载持久化的本地 CA/叶子证书，不存在时生成覆盖 127.0.0.1/localhost/局域网 IP 的新证书
+func ensureScriptHTTPSelfSignedCert() (*tls.Certificate, []byte, error) {
+	dir, err := scriptHTTPCertConfigDir()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	caPath := filepath.Join(dir, scriptHTTPCAName)
+	caKeyPath := filepath.Join(dir, scriptHTTPCAKey)
+	leafPath := filepath.Join(dir, scriptHTTPLeafName)
+	leafKeyPath := filepath.Join(dir, scriptHTTPLeafKey)
+
+	if fileExists(caPath) && fileExists(leafPath) && fileExists(leafKeyPath) {
+		cert, err := tls.LoadX509KeyPair(leafPath, leafKeyPath)
+		if err == nil {
+			caPEM, err := os.ReadFile(caPath)
+			if err == nil {
+				return &cert, caPEM, nil
+			}
+		}
+	}
+
+	caCertPEM, caKeyPEM, caCert, caKey, err := generateScriptHTTPLocalCA()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(caPath, caCertPEM, 0600); err != nil {
+		return nil, nil, fmt.Errorf("保存 CA 证书失败: %v", err)
+	}
+	if err := os.WriteFile(caKeyPath, caKeyPEM, 0600); err != nil {
+		return nil, nil, fmt.Errorf("保存 CA 私钥失败: %v", err)
+	}
+
+	leafCertPEM, leafKeyPEM, err := generateScriptHTTPLeafCert(caCert, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(leafPath, leafCertPEM, 0600); err != nil {
+		return nil, nil, fmt.Errorf("保存证书失败: %v", err)
+	}
+	if err := os.WriteFile(leafKeyPath, leafKeyPEM, 0600); err != nil {
+		return nil, nil, fmt.Errorf("保存私钥失败: %v", err)
+	}
+
+	cert, err := tls.X509KeyPair(leafCertPEM, leafKeyPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("加载新生成的证书失败: %v", err)
+	}
+	log.Printf("✅ 已生成本地自签名 CA 与证书: %s", dir)
+	return &cert, caCertPEM, nil
+}
+
+// generateScriptHTTPLocalCA 生成一个本地根 CA
+func generateScriptHTTPLocalCA() (certPEM, keyPEM []byte, cert *x509.Certificate, key *ecdsa.PrivateKey, err error) {
+	key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("生成 CA 私钥失败: %v", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("生成序列号失败: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "clip-save local CA", Organization: []string{"clip-save"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("创建 CA 证书失败: %v", err)
+	}
+
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("解析 CA 证书失败: %v", err)
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("序列化 CA 私钥失败: %v", err)
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM, cert, key, nil
+}
+
+// generateScriptHTTPLeafCert 基于本地 CA 签发覆盖 127.0.0.1/localhost/局域网 IP 的叶子证书
+func generateScriptHTTPLeafCert(caCert *x509.Certificate, caKey *ecdsa.PrivateKey) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("生成证书私钥失败: %v", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("生成序列号失败: %v", err)
+	}
+
+	ips := []net.IP{net.ParseIP("127.0.0.1")}
+	if lanIP, err := getLocalIP(); err == nil {
+		if parsed := net.ParseIP(lanIP); parsed != nil {
+			ips = append(ips, parsed)
+		}
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "clip-save", Organization: []string{"clip-save"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(2, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  ips,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("签发证书失败: %v", err)
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("序列化私钥失败: %v", err)
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM, nil
+}
+
+// fileExists 判断文件是否存在
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// buildScriptHTTPHandler 按配置包装 h2c（TLS 关闭且允许明文 H2 时）
+func buildScriptHTTPHandler(cfg ScriptHTTPServerConfig, handler http.Handler) http.Handler {
+	if (cfg.TLS.Mode == "" || cfg.TLS.Mode == TLSModeOff) && cfg.H2C {
+		return h2c.NewHandler(handler, &http2.Server{})
+	}
+	return handler
+}
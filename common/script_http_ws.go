@@ -0,0 +1,242 @@
+package common
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WSChannel 一条脚本 HTTP WebSocket 连接
+type WSChannel struct {
+	Sid     string
+	Conn    *websocket.Conn
+	Request *http.Request
+	Time    time.Time
+
+	writeMutex sync.Mutex
+}
+
+var (
+	wsUpgrader = websocket.Upgrader{
+		ReadBufferSize:  4096,
+		WriteBufferSize: 4096,
+		CheckOrigin:     func(r *http.Request) bool { return true },
+	}
+
+	wsChannels      = make(map[string]*WSChannel) // sid -> channel
+	wsChannelsMutex sync.RWMutex
+
+	wsHeartbeatInterval = 30 * time.Second
+)
+
+// writeJSON 并发安全地向连接写入一条 JSON 消息
+func (c *WSChannel) writeJSON(v interface{}) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.Conn.WriteJSON(v)
+}
+
+// handleScriptHTTPWebSocket 升级 /clip-save/<identifier>/ws 连接，建立长连接会话
+func handleScriptHTTPWebSocket(w http.ResponseWriter, r *http.Request, identifier string, script *UserScript) {
+	if !authenticateScriptHTTPRequest(w, r, identifier) {
+		return
+	}
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("❌ 脚本 HTTP WebSocket 升级失败: %v", err)
+		return
+	}
+
+	requestCounterMutex.Lock()
+	requestCounter++
+	sid := fmt.Sprintf("ws_%d_%d", time.Now().Unix(), requestCounter)
+	requestCounterMutex.Unlock()
+
+	channel := &WSChannel{
+		Sid:     sid,
+		Conn:    conn,
+		Request: r,
+		Time:    time.Now(),
+	}
+
+	wsChannelsMutex.Lock()
+	wsChannels[sid] = channel
+	wsChannelsMutex.Unlock()
+
+	log.Printf("✅ 脚本 HTTP WebSocket 已建立: %s -> /clip-save/%s/ws", sid, identifier)
+
+	go scriptHTTPWebSocketHeartbeat(channel)
+	scriptHTTPWebSocketReadLoop(channel, identifier, script)
+}
+
+// scriptHTTPWebSocketReadLoop 持续读取同一条连接上的多帧 content 请求
+func scriptHTTPWebSocketReadLoop(channel *WSChannel, identifier string, script *UserScript) {
+	defer func() {
+		wsChannelsMutex.Lock()
+		delete(wsChannels, channel.Sid)
+		wsChannelsMutex.Unlock()
+		channel.Conn.Close()
+
+		// 连接关闭时清理所有还在等待结果、挂在这条连接上的请求映射，避免泄漏
+		wsRequestChannelsMutex.Lock()
+		for requestID, sid := range wsRequestChannels {
+			if sid == channel.Sid {
+				delete(wsRequestChannels, requestID)
+			}
+		}
+		wsRequestChannelsMutex.Unlock()
+
+		log.Printf("🧹 脚本 HTTP WebSocket 已关闭: %s", channel.Sid)
+	}()
+
+	for {
+		var frame struct {
+			Content string `json:"content"`
+		}
+		if err := channel.Conn.ReadJSON(&frame); err != nil {
+			return
+		}
+
+		requestCounterMutex.Lock()
+		requestCounter++
+		requestID := fmt.Sprintf("req_%d_%d", time.Now().Unix(), requestCounter)
+		requestCounterMutex.Unlock()
+
+		wsRequestChannelsMutex.Lock()
+		wsRequestChannels[requestID] = channel.Sid
+		wsRequestChannelsMutex.Unlock()
+
+		if globalScriptEventCallback != nil {
+			globalScriptEventCallback("script.http.execute", map[string]interface{}{
+				"requestID": requestID,
+				"scriptID":  script.ID,
+				"content":   frame.Content,
+				"sid":       channel.Sid,
+			})
+		}
+	}
+}
+
+// scriptHTTPWebSocketHeartbeat 每 30 秒发送一次心跳，连接失效时停止
+func scriptHTTPWebSocketHeartbeat(channel *WSChannel) {
+	ticker := time.NewTicker(wsHeartbeatInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		wsChannelsMutex.RLock()
+		_, exists := wsChannels[channel.Sid]
+		wsChannelsMutex.RUnlock()
+		if !exists {
+			return
+		}
+
+		if err := channel.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second)); err != nil {
+			return
+		}
+	}
+}
+
+// wsRequestChannels 记录通过 WebSocket 发起的请求对应的连接 sid，供结果回传使用
+var (
+	wsRequestChannels      = make(map[string]string) // requestID -> sid
+	wsRequestChannelsMutex sync.Mutex
+)
+
+// SendScriptHTTPChunk 向发起 requestID 对应请求的 WebSocket 连接推送一个进度分片
+func SendScriptHTTPChunk(requestID string, chunk interface{}) {
+	wsRequestChannelsMutex.Lock()
+	sid, exists := wsRequestChannels[requestID]
+	wsRequestChannelsMutex.Unlock()
+	if !exists {
+		return
+	}
+
+	wsChannelsMutex.RLock()
+	channel, exists := wsChannels[sid]
+	wsChannelsMutex.RUnlock()
+	if !exists {
+		return
+	}
+
+	if err := channel.writeJSON(map[string]interface{}{
+		"type":      "script.http.chunk",
+		"requestID": requestID,
+		"chunk":     chunk,
+	}); err != nil {
+		log.Printf("❌ 推送脚本 HTTP 分片失败: %v", err)
+	}
+}
+
+// finishScriptHTTPWebSocketRequest 向 WebSocket 连接发送 done/error 消息并清理映射
+func finishScriptHTTPWebSocketRequest(requestID string, result ScriptHTTPResult) bool {
+	wsRequestChannelsMutex.Lock()
+	sid, exists := wsRequestChannels[requestID]
+	if exists {
+		delete(wsRequestChannels, requestID)
+	}
+	wsRequestChannelsMutex.Unlock()
+	if !exists {
+		return false
+	}
+
+	wsChannelsMutex.RLock()
+	channel, exists := wsChannels[sid]
+	wsChannelsMutex.RUnlock()
+	if !exists {
+		return true
+	}
+
+	msgType := "script.http.done"
+	if result.Error != "" {
+		msgType = "script.http.error"
+	}
+
+	if err := channel.writeJSON(map[string]interface{}{
+		"type":        msgType,
+		"requestID":   requestID,
+		"returnValue": result.ReturnValue,
+		"error":       result.Error,
+	}); err != nil {
+		log.Printf("❌ 推送脚本 HTTP 完成消息失败: %v", err)
+	}
+
+	return true
+}
+
+// cleanupDeadScriptHTTPWebSockets 探测并关闭已经失活的 WebSocket 连接（防止内存泄漏）
+func cleanupDeadScriptHTTPWebSockets() {
+	wsChannelsMutex.RLock()
+	channels := make([]*WSChannel, 0, len(wsChannels))
+	for _, channel := range wsChannels {
+		channels = append(channels, channel)
+	}
+	wsChannelsMutex.RUnlock()
+
+	closed := 0
+	for _, channel := range channels {
+		if err := channel.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second)); err != nil {
+			wsChannelsMutex.Lock()
+			delete(wsChannels, channel.Sid)
+			wsChannelsMutex.Unlock()
+			channel.Conn.Close()
+			closed++
+		}
+	}
+	if closed > 0 {
+		log.Printf("🧹 清理了 %d 个失效的脚本 HTTP WebSocket 连接", closed)
+	}
+}
+
+// isScriptHTTPWebSocketPath 判断路径是否命中 /clip-save/<identifier>/ws
+func isScriptHTTPWebSocketPath(path string) (string, bool) {
+	if strings.HasSuffix(path, "/ws") {
+		return strings.TrimSuffix(path, "/ws"), true
+	}
+	return "", false
+}